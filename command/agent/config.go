@@ -0,0 +1,584 @@
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultBindPort is the default port that Serf will bind to for
+// gossip if one is not specified in the BindAddr.
+const DefaultBindPort int = 7946
+
+// EventScript is a single filter/script pair parsed out of a
+// Config.EventHandlers entry. NodeEvent is the event filter ("*" for
+// all events, or the event name), Name is the optional user event
+// name filter (only meaningful when NodeEvent is "user"), and Script
+// is the path to the handler that will be invoked.
+type EventScript struct {
+	NodeEvent string
+	Name      string
+	Script    string
+}
+
+// Config is the configuration that can be set for an Agent. Some of
+// these configurations are exposed as command-line flags to `serf agent`,
+// while many of the more advanced configurations can only be set by
+// creating a configuration file.
+type Config struct {
+	// NodeName is the name we use to advertise. If not provided, the
+	// hostname is used.
+	NodeName string `json:"node_name" mapstructure:"node_name"`
+
+	// Role is used to track the current role of the agent, if any.
+	Role string `json:"role" mapstructure:"role"`
+
+	// Tags are used to attach key/value metadata to a node.
+	Tags map[string]string `json:"tags" mapstructure:"tags"`
+
+	// TagsFile is the path to a file to persist the tags in, so that
+	// they can survive a restart/reload.
+	TagsFile string `json:"tags_file" mapstructure:"tags_file"`
+
+	// BindAddr is the address that the Serf agent's communication ports
+	// will bind to. Serf will use this address to bind to for both TCP
+	// and UDP connections. If no port is present in the address, the
+	// default port will be used.
+	BindAddr string `json:"bind" mapstructure:"bind"`
+
+	// AdvertiseAddr is the address that the Serf agent will advertise to
+	// other members of the cluster. Can be used for basic NAT traversal
+	// where both the internal and external addresses are known.
+	AdvertiseAddr string `json:"advertise" mapstructure:"advertise"`
+
+	// EncryptKey is the secret key to use for encrypting communication
+	// traffic for Serf. The secret key must be base64 encoded. The
+	// default format is 16 bytes (AES-128).
+	EncryptKey string `json:"encrypt_key" mapstructure:"encrypt_key"`
+
+	// LogLevel is the level of the logs to output.
+	LogLevel string `json:"log_level" mapstructure:"log_level"`
+
+	// Protocol is the Serf protocol version to use.
+	Protocol int `json:"protocol" mapstructure:"protocol"`
+
+	// ReplayOnJoin tells Serf to replay past user events when joining
+	// based on a `StartJoin`.
+	ReplayOnJoin bool `json:"replay_on_join" mapstructure:"replay_on_join"`
+
+	// EventHandlers is a list of event handlers that will be invoked.
+	// They can be specified using the `-event-handler` flag, and the
+	// format is `[filter=]script`.
+	EventHandlers []string `json:"event_handlers" mapstructure:"event_handlers"`
+
+	// StartJoin is a list of addresses to attempt to join when the
+	// agent starts. If Serf is unable to join with any of these
+	// addresses, the agent will error and exit.
+	StartJoin []string `json:"start_join" mapstructure:"start_join"`
+}
+
+// DefaultConfig is the default configuration used when none is supplied
+// by the user. Callers should treat this as read-only and copy it via
+// MergeConfig if mutation is required.
+var DefaultConfig = &Config{
+	BindAddr: fmt.Sprintf("0.0.0.0:%d", DefaultBindPort),
+	LogLevel: "INFO",
+	Protocol: 4,
+}
+
+// BindAddrParts returns the parts of the BindAddr, filling in defaults
+// as necessary.
+func (c *Config) BindAddrParts() (string, int, error) {
+	return splitHostPortDefault(c.BindAddr, DefaultBindPort)
+}
+
+// splitHostPortDefault splits addr into host and port, appending
+// defaultPort first if addr didn't carry one of its own. This is how
+// a bare host like "10.0.0.1" is allowed wherever an address is
+// accepted: Serf fills in the gossip port itself.
+func splitHostPortDefault(addr string, defaultPort int) (string, int, error) {
+	checkAddr := addr
+
+START:
+	_, _, err := net.SplitHostPort(checkAddr)
+	if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+		checkAddr = fmt.Sprintf("%s:%d", checkAddr, defaultPort)
+		goto START
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	host, port, err := net.SplitHostPort(checkAddr)
+	if err != nil {
+		return "", 0, err
+	}
+
+	portInt, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return host, portInt, nil
+}
+
+// EncryptBytes returns the encryption key configured, decoded from
+// base64, or an empty slice if one is not configured.
+func (c *Config) EncryptBytes() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(c.EncryptKey)
+}
+
+// EventScripts parses the configured EventHandlers into EventScripts.
+// Each entry is either a bare script ("foo.sh", implicitly filtered to
+// "*", every event) or "filter=script", where filter is the node
+// event to match, or "user:name" to match only the named user event.
+// Every malformed entry is reported, aggregated via go-multierror,
+// rather than stopping at the first one.
+func (c *Config) EventScripts() ([]EventScript, error) {
+	var errs *multierror.Error
+	result := make([]EventScript, 0, len(c.EventHandlers))
+
+	for _, v := range c.EventHandlers {
+		part := strings.SplitN(v, "=", 2)
+
+		var filter, script string
+		if len(part) == 1 {
+			filter, script = "*", part[0]
+		} else {
+			filter, script = part[0], part[1]
+			if filter == "" {
+				errs = multierror.Append(errs, fmt.Errorf("invalid event handler %q: missing filter before '='", v))
+				continue
+			}
+		}
+
+		if script == "" {
+			errs = multierror.Append(errs, fmt.Errorf("invalid event handler %q: missing script", v))
+			continue
+		}
+
+		var nodeEvent, name string
+		if strings.HasPrefix(filter, "user:") {
+			nodeEvent, name = "user", strings.TrimPrefix(filter, "user:")
+			if name == "" {
+				errs = multierror.Append(errs, fmt.Errorf("invalid event handler %q: missing user event name after 'user:'", v))
+				continue
+			}
+		} else {
+			nodeEvent = filter
+		}
+
+		result = append(result, EventScript{
+			NodeEvent: nodeEvent,
+			Name:      name,
+			Script:    script,
+		})
+	}
+
+	return result, errs.ErrorOrNil()
+}
+
+// decodeConfigFormat decodes a raw byte slice in the given format into
+// a map, suitable for passing to mapstructure. "json" is not handled
+// here: decodeConfigFile and DecodeConfig send it to decodeJSON, which
+// decodes directly into a *Config, matching historical behavior.
+func decodeConfigFormat(format string, raw []byte) (map[string]interface{}, error) {
+	var out map[string]interface{}
+
+	switch format {
+	case "yaml", "yml":
+		var rawYaml map[interface{}]interface{}
+		if err := yaml.Unmarshal(raw, &rawYaml); err != nil {
+			return nil, err
+		}
+		out = cleanYamlKeys(rawYaml)
+
+	case "toml":
+		if _, err := toml.Decode(string(raw), &out); err != nil {
+			return nil, err
+		}
+
+	case "hcl":
+		if err := hcl.Decode(&out, string(raw)); err != nil {
+			return nil, err
+		}
+		flattenHCLObjects(out)
+
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+
+	return out, nil
+}
+
+// cleanYamlKeys recursively converts the map[interface{}]interface{}
+// produced by yaml.v2 into map[string]interface{}, which is what
+// mapstructure and the other formats expect.
+func cleanYamlKeys(in map[interface{}]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		key := fmt.Sprintf("%v", k)
+		switch val := v.(type) {
+		case map[interface{}]interface{}:
+			out[key] = cleanYamlKeys(val)
+		default:
+			out[key] = v
+		}
+	}
+	return out
+}
+
+// flattenHCLObjects undoes a quirk of hcl.Decode: an object-typed
+// value, whether written as a block ("tags { dc = \"east\" }") or an
+// assignment ("tags = { dc = \"east\" }"), comes back as
+// []map[string]interface{} with a single element instead of a plain
+// map[string]interface{}. mapstructure has no way to put that slice
+// into a map[string]string field like Tags, so it's flattened back
+// down (recursively, since the same quirk applies at any nesting
+// depth) before the result is handed to decodeConfigMap.
+func flattenHCLObjects(m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case []map[string]interface{}:
+			if len(val) == 1 {
+				flattenHCLObjects(val[0])
+				m[k] = val[0]
+			}
+		case map[string]interface{}:
+			flattenHCLObjects(val)
+		}
+	}
+}
+
+// DecodeConfig reads the JSON configuration from the given reader and
+// returns a Config, with any field not present in the input left at
+// its DefaultConfig value. Decoding is strict: unknown keys (such as
+// a misspelled field name) are rejected rather than silently ignored.
+func DecodeConfig(r io.Reader) (*Config, error) {
+	result, err := decodeJSON(r, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return MergeConfig(DefaultConfig, result), nil
+}
+
+// decodeJSON performs the bare JSON decode, with no defaults applied.
+// ReadConfigPaths uses this directly (rather than DecodeConfig) while
+// merging multiple files together, since seeding every individual
+// file with DefaultConfig would make a later file that omits a field
+// clobber an earlier file's explicit value for it; defaults are
+// applied exactly once, after all files and env overrides have been
+// merged.
+//
+// Decoding is strict (unknown keys, such as a misspelled field name,
+// are rejected) unless permissive is true, in which case unknown keys
+// are ignored, as ReadConfigPathsPermissive describes.
+func decodeJSON(r io.Reader, permissive bool) (*Config, error) {
+	var result Config
+	dec := json.NewDecoder(r)
+	if !permissive {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// decodeConfigFile reads the configuration at path, detecting the
+// format by extension, and decodes it into a Config. See decodeJSON
+// for the meaning of permissive.
+func decodeConfigFile(path string, permissive bool) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if ext == "json" {
+		return decodeJSON(f, permissive)
+	}
+
+	raw, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rawMap, err := decodeConfigFormat(ext, raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+
+	result, err := decodeConfigMap(rawMap, permissive)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+
+	return result, nil
+}
+
+// decodeConfigMap decodes a raw, format-agnostic map into a Config.
+// Like decodeJSON, this is strict by default: a key in rawMap that
+// doesn't correspond to a known Config field is an error, matching
+// json.Decoder.DisallowUnknownFields' behavior for the JSON path. When
+// permissive is true, unused keys are left unreported instead.
+func decodeConfigMap(rawMap map[string]interface{}, permissive bool) (*Config, error) {
+	var result Config
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: !permissive,
+		Result:      &result,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decoder.Decode(rawMap); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// configFormatOf returns the recognized config format for the given
+// path's extension, or "" if the extension isn't one we understand.
+func configFormatOf(path string) string {
+	switch strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".") {
+	case "json":
+		return "json"
+	case "yaml", "yml":
+		return "yaml"
+	case "toml":
+		return "toml"
+	case "hcl":
+		return "hcl"
+	default:
+		return ""
+	}
+}
+
+// MergeConfig merges two configurations together to make a single new
+// configuration. Values in the latter configuration take precedence
+// over the former, with the exception of slice values, which are
+// appended.
+func MergeConfig(a, b *Config) *Config {
+	result := *a
+
+	if b.NodeName != "" {
+		result.NodeName = b.NodeName
+	}
+	if b.Role != "" {
+		result.Role = b.Role
+	}
+	if b.BindAddr != "" {
+		result.BindAddr = b.BindAddr
+	}
+	if b.AdvertiseAddr != "" {
+		result.AdvertiseAddr = b.AdvertiseAddr
+	}
+	if b.EncryptKey != "" {
+		result.EncryptKey = b.EncryptKey
+	}
+	if b.LogLevel != "" {
+		result.LogLevel = b.LogLevel
+	}
+	if b.Protocol > 0 {
+		result.Protocol = b.Protocol
+	}
+	if b.TagsFile != "" {
+		result.TagsFile = b.TagsFile
+	}
+	if b.ReplayOnJoin {
+		result.ReplayOnJoin = true
+	}
+
+	if b.Tags != nil {
+		result.Tags = make(map[string]string)
+		for k, v := range a.Tags {
+			result.Tags[k] = v
+		}
+		for k, v := range b.Tags {
+			result.Tags[k] = v
+		}
+	}
+
+	result.EventHandlers = append(a.EventHandlers, b.EventHandlers...)
+	result.StartJoin = append(a.StartJoin, b.StartJoin...)
+
+	return &result
+}
+
+// ReadConfigPaths reads the paths in the given order to load the
+// configuration. Files are decoded by their extension: .json, .yaml,
+// .yml, .toml, and .hcl are all understood, and mixed formats may be
+// combined freely. As files are read, their contents are merged into
+// the final configuration, with later values winning, exactly as
+// MergeConfig specifies.
+//
+// If a path is a directory, we read all files in the directory that
+// have a recognized extension, in lexical order, skipping anything
+// else. Only the extension is checked, so a dotfile such as
+// ".local.json" is read too. If a path is a file, it is read directly,
+// falling back to JSON if it carries no recognized extension, for
+// backwards compatibility with existing deployments.
+//
+// The merged result is validated via Config.Validate, and an invalid
+// config is refused. Use ReadConfigPathsPermissive to load anyway.
+func ReadConfigPaths(paths []string) (*Config, error) {
+	return ReadConfigPathsPermissive(paths, false)
+}
+
+// ReadConfigPathsPermissive behaves exactly like ReadConfigPaths, but
+// when permissive is true, two kinds of problems are tolerated
+// instead of rejected: a config that fails Validate is still
+// returned, and an unrecognized key in any file is ignored rather
+// than failing the decode outright. Nothing in this package sets
+// permissive from a command-line flag; the caller passes it. Malformed
+// input (e.g. invalid JSON/YAML/TOML/HCL syntax) is never tolerated,
+// permissive or not, since there's no reasonable config to fall back
+// to in that case.
+func ReadConfigPathsPermissive(paths []string, permissive bool) (*Config, error) {
+	result := new(Config)
+	var fileErrs *multierror.Error
+
+	validate := func(path string, config *Config) {
+		if err := config.validateFile(path); err != nil {
+			fileErrs = multierror.Append(fileErrs, err)
+		}
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+		}
+
+		if !fi.IsDir() {
+			config, err := decodeConfigFileFallback(path, permissive)
+			if err != nil {
+				return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+			}
+			validate(path, config)
+
+			result = MergeConfig(result, config)
+			continue
+		}
+
+		contents, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+		}
+
+		names := make([]string, 0, len(contents))
+		for _, fi := range contents {
+			if fi.IsDir() {
+				continue
+			}
+			if configFormatOf(fi.Name()) == "" {
+				continue
+			}
+			names = append(names, fi.Name())
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			full := filepath.Join(path, name)
+			config, err := decodeConfigFile(full, permissive)
+			if err != nil {
+				return nil, fmt.Errorf("Error decoding '%s': %s", name, err)
+			}
+			validate(full, config)
+
+			result = MergeConfig(result, config)
+		}
+	}
+
+	result.LoadEnv()
+
+	// Defaults are applied exactly once, after every file and env
+	// override has been merged in, so that an earlier file's explicit
+	// value is never clobbered by a later file simply omitting that
+	// field (see decodeJSON).
+	result = MergeConfig(DefaultConfig, result)
+
+	// Validate the fully assembled config too, tagged as "(merged)"
+	// rather than any single file, so that problems only visible once
+	// everything is combined (e.g. an env override) are still caught.
+	// A merged-pass error with the same pointer and message as one
+	// already reported against a specific file isn't repeated here;
+	// one whose pointer or message differs (such as a start_join entry
+	// at a new index after merging) is reported again.
+	mergedErrs, _ := result.validateFile("(merged)").(*multierror.Error)
+	err := mergeNewConfigErrors(fileErrs, mergedErrs).ErrorOrNil()
+
+	if err != nil && !permissive {
+		return nil, fmt.Errorf("config validation failed: %s", err)
+	}
+
+	return result, nil
+}
+
+// mergeNewConfigErrors combines perFile with whichever errors in
+// merged aren't already present (by pointer and message) in perFile,
+// so that an issue traced to a specific file during the per-file pass
+// isn't reported a second time, untagged, from the final merged pass.
+func mergeNewConfigErrors(perFile, merged *multierror.Error) *multierror.Error {
+	var result *multierror.Error
+	seen := make(map[string]bool)
+
+	if perFile != nil {
+		for _, e := range perFile.Errors {
+			result = multierror.Append(result, e)
+			if ce, ok := e.(*ConfigError); ok {
+				seen[ce.Pointer+": "+ce.Err.Error()] = true
+			}
+		}
+	}
+
+	if merged != nil {
+		for _, e := range merged.Errors {
+			if ce, ok := e.(*ConfigError); ok {
+				if seen[ce.Pointer+": "+ce.Err.Error()] {
+					continue
+				}
+			}
+			result = multierror.Append(result, e)
+		}
+	}
+
+	return result
+}
+
+// decodeConfigFileFallback decodes a single, explicitly-specified
+// config file. Unlike directory scanning, an unrecognized extension
+// here falls back to JSON rather than being skipped, since the
+// operator pointed us at this exact file.
+func decodeConfigFileFallback(path string, permissive bool) (*Config, error) {
+	if configFormatOf(path) == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return decodeJSON(f, permissive)
+	}
+
+	return decodeConfigFile(path, permissive)
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"os"
+	"strings"
+)
+
+// EnvBinding describes the prioritized list of environment variable
+// names that map to a single Config field. The first variable in Keys
+// that is set and non-empty wins; this lets us support legacy
+// variable names without breaking existing deployments.
+type EnvBinding struct {
+	Field string
+	Keys  []string
+}
+
+// BindEnv is the table of environment variable overrides that
+// Config.LoadEnv applies. It is exported so that callers (and tests)
+// can introspect which variables are understood without duplicating
+// the list.
+var BindEnv = []EnvBinding{
+	{Field: "NodeName", Keys: []string{"SERF_NODE_NAME"}},
+	{Field: "Role", Keys: []string{"SERF_ROLE"}},
+	{Field: "BindAddr", Keys: []string{"SERF_BIND", "SERF_BIND_ADDR"}},
+	{Field: "AdvertiseAddr", Keys: []string{"SERF_ADVERTISE"}},
+	{Field: "EncryptKey", Keys: []string{"SERF_ENCRYPT_KEY", "SERF_ENCRYPT"}},
+	{Field: "LogLevel", Keys: []string{"SERF_LOG_LEVEL"}},
+	{Field: "EventHandlers", Keys: []string{"SERF_EVENT_HANDLERS"}},
+	{Field: "StartJoin", Keys: []string{"SERF_START_JOIN"}},
+}
+
+// firstNonEmptyEnv returns the value of the first key in keys that is
+// set to a non-empty value in the environment, and ok=true. If none
+// are set, it returns ok=false.
+func firstNonEmptyEnv(keys []string) (string, bool) {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// LoadEnv applies environment variable overrides on top of c, per the
+// BindEnv table. Scalar fields are overwritten outright; EventHandlers
+// and StartJoin are comma-separated lists that get appended to
+// whatever was already loaded from config files, matching
+// MergeConfig's slice-appending semantics. Env overrides are meant to
+// sit between file config and CLI flags: callers that also apply
+// flags should MergeConfig the flag-derived Config on top of the
+// result of LoadEnv so that flags win.
+func (c *Config) LoadEnv() {
+	for _, b := range BindEnv {
+		v, ok := firstNonEmptyEnv(b.Keys)
+		if !ok {
+			continue
+		}
+
+		switch b.Field {
+		case "NodeName":
+			c.NodeName = v
+		case "Role":
+			c.Role = v
+		case "BindAddr":
+			c.BindAddr = v
+		case "AdvertiseAddr":
+			c.AdvertiseAddr = v
+		case "EncryptKey":
+			c.EncryptKey = v
+		case "LogLevel":
+			c.LogLevel = v
+		case "EventHandlers":
+			c.EventHandlers = append(c.EventHandlers, splitEnvList(v)...)
+		case "StartJoin":
+			c.StartJoin = append(c.StartJoin, splitEnvList(v)...)
+		}
+	}
+}
+
+// splitEnvList splits a comma-separated environment variable value
+// into its parts, trimming whitespace and dropping empty entries.
+func splitEnvList(v string) []string {
+	parts := strings.Split(v, ",")
+	result := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
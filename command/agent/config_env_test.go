@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func setEnv(t *testing.T, vars map[string]string) {
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func unsetEnv(vars map[string]string) {
+	for k := range vars {
+		os.Unsetenv(k)
+	}
+}
+
+func TestConfigLoadEnv_overridesFile(t *testing.T) {
+	vars := map[string]string{
+		"SERF_NODE_NAME":   "env-node",
+		"SERF_BIND":        "1.2.3.4",
+		"SERF_ENCRYPT_KEY": "env-key",
+	}
+	setEnv(t, vars)
+	defer unsetEnv(vars)
+
+	c := &Config{
+		NodeName:   "file-node",
+		BindAddr:   "0.0.0.0",
+		EncryptKey: "file-key",
+	}
+	c.LoadEnv()
+
+	if c.NodeName != "env-node" {
+		t.Fatalf("bad: %#v", c)
+	}
+	if c.BindAddr != "1.2.3.4" {
+		t.Fatalf("bad: %#v", c)
+	}
+	if c.EncryptKey != "env-key" {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
+func TestConfigLoadEnv_legacyKeyFallback(t *testing.T) {
+	vars := map[string]string{"SERF_BIND_ADDR": "5.6.7.8"}
+	setEnv(t, vars)
+	defer unsetEnv(vars)
+
+	c := &Config{}
+	c.LoadEnv()
+
+	if c.BindAddr != "5.6.7.8" {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
+func TestConfigLoadEnv_noOverrideWhenUnset(t *testing.T) {
+	c := &Config{NodeName: "file-node"}
+	c.LoadEnv()
+
+	if c.NodeName != "file-node" {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
+func TestConfigLoadEnv_appendsSlices(t *testing.T) {
+	vars := map[string]string{
+		"SERF_EVENT_HANDLERS": "foo.sh, bar=blah.sh",
+		"SERF_START_JOIN":     "10.0.0.1,10.0.0.2",
+	}
+	setEnv(t, vars)
+	defer unsetEnv(vars)
+
+	c := &Config{
+		EventHandlers: []string{"existing.sh"},
+		StartJoin:     []string{"10.0.0.0"},
+	}
+	c.LoadEnv()
+
+	expectedHandlers := []string{"existing.sh", "foo.sh", "bar=blah.sh"}
+	if !reflect.DeepEqual(c.EventHandlers, expectedHandlers) {
+		t.Fatalf("bad: %#v", c.EventHandlers)
+	}
+
+	expectedJoin := []string{"10.0.0.0", "10.0.0.1", "10.0.0.2"}
+	if !reflect.DeepEqual(c.StartJoin, expectedJoin) {
+		t.Fatalf("bad: %#v", c.StartJoin)
+	}
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigPaths_yaml(t *testing.T) {
+	tf, err := ioutil.TempFile("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	yamlPath := tf.Name() + ".yaml"
+	if err := os.Rename(tf.Name(), yamlPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(yamlPath)
+
+	if err := ioutil.WriteFile(yamlPath, []byte("node_name: bar\nrole: web\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config, err := ReadConfigPaths([]string{yamlPath})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.NodeName != "bar" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.Role != "web" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestReadConfigPaths_toml(t *testing.T) {
+	tf, err := ioutil.TempFile("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	tomlPath := tf.Name() + ".toml"
+	if err := os.Rename(tf.Name(), tomlPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tomlPath)
+
+	if err := ioutil.WriteFile(tomlPath, []byte("node_name = \"bar\"\nprotocol = 7\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config, err := ReadConfigPaths([]string{tomlPath})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.NodeName != "bar" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.Protocol != 7 {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestReadConfigPaths_hcl(t *testing.T) {
+	tf, err := ioutil.TempFile("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	hclPath := tf.Name() + ".hcl"
+	if err := os.Rename(tf.Name(), hclPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(hclPath)
+
+	input := `
+node_name = "bar"
+start_join = ["10.0.0.1", "10.0.0.2"]
+event_handlers = ["foo.sh"]
+
+tags {
+	dc = "east"
+}
+`
+	if err := ioutil.WriteFile(hclPath, []byte(input), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config, err := ReadConfigPaths([]string{hclPath})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.NodeName != "bar" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if len(config.StartJoin) != 2 || config.StartJoin[0] != "10.0.0.1" || config.StartJoin[1] != "10.0.0.2" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if len(config.EventHandlers) != 1 || config.EventHandlers[0] != "foo.sh" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.Tags["dc"] != "east" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestReadConfigPaths_mixedFormats(t *testing.T) {
+	td, err := ioutil.TempDir("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// a.json is merged first, then b.yaml, so b's values win per
+	// MergeConfig's last-one-wins semantics.
+	err = ioutil.WriteFile(filepath.Join(td, "a.json"),
+		[]byte(`{"node_name": "bar", "role": "web"}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(td, "b.yaml"),
+		[]byte("node_name: baz\n"), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Still ignored, just like a plain extensionless file in the JSON-only test.
+	err = ioutil.WriteFile(filepath.Join(td, "c"),
+		[]byte(`{"node_name": "bad"}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config, err := ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.NodeName != "baz" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.Role != "web" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
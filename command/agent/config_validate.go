@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ConfigError wraps a single Config validation failure with enough
+// context to find it again. Pointer is a JSON-pointer-style path into
+// the field that failed (e.g. "/start_join/0"); since none of our
+// decoders currently retain source line numbers, it is built from the
+// field name rather than an offset into the original file. File is
+// the path of the config file the value came from, "(merged)" for a
+// problem ReadConfigPaths finds in the combined result of all files
+// and env overrides, and empty when Validate is called directly.
+type ConfigError struct {
+	File    string
+	Pointer string
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%s: %s", e.Pointer, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Pointer, e.Err)
+}
+
+// Validate cross-checks the invariants DecodeConfig can't enforce on
+// its own: that addresses are well-formed, the encrypt key decodes to
+// a usable AES key size, event handlers parse, and start_join entries
+// are host[:port] addresses. It returns every problem found, aggregated via
+// go-multierror, rather than stopping at the first one.
+func (c *Config) Validate() error {
+	return c.validateFile("")
+}
+
+// validateFile is Validate with every resulting ConfigError tagged
+// with the given source file path, so that ReadConfigPaths can report
+// which of several merged files a problem came from. An empty path
+// leaves errors untagged, which is what the exported Validate uses.
+func (c *Config) validateFile(file string) error {
+	var result *multierror.Error
+	appendErr := func(pointer string, err error) {
+		result = multierror.Append(result, &ConfigError{File: file, Pointer: pointer, Err: err})
+	}
+
+	if _, _, err := c.BindAddrParts(); err != nil {
+		appendErr("/bind", err)
+	}
+
+	if c.AdvertiseAddr != "" {
+		if _, _, err := splitHostPortDefault(c.AdvertiseAddr, DefaultBindPort); err != nil {
+			appendErr("/advertise", err)
+		}
+	}
+
+	if c.EncryptKey != "" {
+		key, err := c.EncryptBytes()
+		if err != nil {
+			appendErr("/encrypt_key", err)
+		} else {
+			switch len(key) {
+			case 16, 24, 32:
+				// valid AES-128/192/256 key sizes
+			default:
+				appendErr("/encrypt_key", fmt.Errorf("must decode to 16, 24, or 32 bytes, got %d", len(key)))
+			}
+		}
+	}
+
+	if scripts, err := c.EventScripts(); err != nil {
+		appendErr("/event_handlers", err)
+	} else {
+		for i, s := range scripts {
+			if s.Script == "" {
+				appendErr(fmt.Sprintf("/event_handlers/%d", i), fmt.Errorf("empty script path"))
+			}
+		}
+	}
+
+	for i, addr := range c.StartJoin {
+		// This is a syntax check only: it confirms addr parses as a
+		// host[:port], not that the host actually resolves. Validate
+		// deliberately doesn't do DNS lookups, since a name that's
+		// unreachable right now may still be perfectly valid once the
+		// agent starts joining.
+		if _, _, err := splitHostPortDefault(addr, DefaultBindPort); err != nil {
+			appendErr(fmt.Sprintf("/start_join/%d", i), fmt.Errorf("%q is not a valid host[:port]: %s", addr, err))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate_ok(t *testing.T) {
+	c := &Config{
+		NodeName:      "foo",
+		BindAddr:      "0.0.0.0:7946",
+		EncryptKey:    base64.StdEncoding.EncodeToString(make([]byte, 16)),
+		EventHandlers: []string{"foo.sh"},
+		StartJoin:     []string{"10.0.0.1:7946"},
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_badEncryptKeySize(t *testing.T) {
+	c := &Config{EncryptKey: base64.StdEncoding.EncodeToString([]byte("tooshort"))}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "/encrypt_key") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestConfigValidate_bareHostStartJoin(t *testing.T) {
+	// A bare host with no port is valid: Serf appends DefaultBindPort
+	// itself, just as it does for BindAddr.
+	c := &Config{StartJoin: []string{"10.0.0.1"}}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_badStartJoin(t *testing.T) {
+	c := &Config{StartJoin: []string{"10.0.0.1:7946:extra"}}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "/start_join/0") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestConfigValidate_aggregatesMultipleErrors(t *testing.T) {
+	c := &Config{
+		EncryptKey: base64.StdEncoding.EncodeToString([]byte("tooshort")),
+		StartJoin:  []string{"10.0.0.1:7946:extra"},
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "/encrypt_key") || !strings.Contains(err.Error(), "/start_join/0") {
+		t.Fatalf("expected both errors to be reported, got: %s", err)
+	}
+}
+
+func TestConfigEventScripts_malformed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler string
+	}{
+		{"missing filter", "=foo.sh"},
+		{"missing script", "bar="},
+		{"missing user event name", "user:=foo.sh"},
+	}
+
+	for _, tc := range testCases {
+		c := &Config{EventHandlers: []string{tc.handler}}
+		if _, err := c.EventScripts(); err == nil {
+			t.Fatalf("%s: expected error for handler %q", tc.name, tc.handler)
+		}
+	}
+}
+
+func TestConfigValidate_malformedEventHandler(t *testing.T) {
+	c := &Config{EventHandlers: []string{"bar="}}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "/event_handlers") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestReadConfigPaths_validationErrorNamesTheFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	goodPath := filepath.Join(td, "a.json")
+	if err := ioutil.WriteFile(goodPath, []byte(`{"node_name": "bar"}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	badPath := filepath.Join(td, "b.json")
+	if err := ioutil.WriteFile(badPath, []byte(`{"encrypt_key": "dG9vc2hvcnQ="}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err = ReadConfigPaths([]string{td})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	if !strings.Contains(err.Error(), badPath) {
+		t.Fatalf("expected error to name %s, got: %s", badPath, err)
+	}
+	if strings.Contains(err.Error(), goodPath) {
+		t.Fatalf("did not expect error to name %s, got: %s", goodPath, err)
+	}
+}
+
+func TestDecodeConfig_strictUnknownField(t *testing.T) {
+	input := `{"node_name": "foo", "bindaddr": "0.0.0.0"}`
+	_, err := DecodeConfig(bytes.NewReader([]byte(input)))
+	if err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestReadConfigPathsPermissive(t *testing.T) {
+	tf, err := ioutil.TempFile("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	tf.Write([]byte(`{"start_join": ["10.0.0.1:7946:extra"]}`))
+	tf.Close()
+
+	if _, err := ReadConfigPaths([]string{tf.Name()}); err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	config, err := ReadConfigPathsPermissive([]string{tf.Name()}, true)
+	if err != nil {
+		t.Fatalf("permissive load should succeed: %s", err)
+	}
+	if len(config.StartJoin) != 1 || config.StartJoin[0] != "10.0.0.1:7946:extra" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestReadConfigPathsPermissive_unknownField(t *testing.T) {
+	tf, err := ioutil.TempFile("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	tf.Write([]byte(`{"node_name": "bar", "not_a_real_field": true}`))
+	tf.Close()
+
+	if _, err := ReadConfigPaths([]string{tf.Name()}); err == nil {
+		t.Fatal("expected decode error for unknown field")
+	}
+
+	config, err := ReadConfigPathsPermissive([]string{tf.Name()}, true)
+	if err != nil {
+		t.Fatalf("permissive load should succeed despite unknown field: %s", err)
+	}
+	if config.NodeName != "bar" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// LiveConfigApplier is implemented by the running Agent (or any test
+// double) to accept the hot-reloadable subset of a newly loaded
+// Config. Fields outside this subset require a full agent restart;
+// WatchConfigPaths only logs when those change.
+type LiveConfigApplier interface {
+	// SetTags updates the agent's advertised tags and role.
+	SetTags(tags map[string]string, role string) error
+
+	// SetEventHandlers replaces the agent's event handler scripts.
+	SetEventHandlers(scripts []EventScript) error
+
+	// SetLogLevel adjusts the minimum level the agent logs at.
+	SetLogLevel(level string)
+
+	// SetEncryptKey rotates the symmetric key used for gossip traffic.
+	SetEncryptKey(key []byte) error
+}
+
+// hotReloadableFields lists the Config fields WatchConfigPaths is
+// able to apply without restarting the agent. Anything else that
+// differs between reloads is logged but otherwise left alone.
+var hotReloadableFields = map[string]bool{
+	"Tags":          true,
+	"Role":          true,
+	"EventHandlers": true,
+	"LogLevel":      true,
+	"EncryptKey":    true,
+}
+
+// configReloadDebounce is how long WatchConfigPaths waits after the
+// last filesystem event before re-reading the config, so that editors
+// which write-then-rename don't trigger a reload per intermediate
+// write.
+const configReloadDebounce = 250 * time.Millisecond
+
+// configDiff returns the names of every top-level Config field that
+// differs between a and b.
+func configDiff(a, b *Config) []string {
+	var changed []string
+
+	av := reflect.ValueOf(*a)
+	bv := reflect.ValueOf(*b)
+	t := av.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if !reflect.DeepEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+			changed = append(changed, t.Field(i).Name)
+		}
+	}
+
+	return changed
+}
+
+// WatchConfigPaths watches the same files and directories that would
+// be passed to ReadConfigPaths. On every change it re-runs the
+// decode+merge+env pipeline, diffs the result against the
+// previously-loaded Config, and applies the hot-reloadable subset to
+// applier. Fields that changed but require a restart are only logged
+// via logger.
+//
+// Writes are debounced so editors that write-then-rename don't cause
+// multiple reloads, and every watched directory is re-scanned on each
+// reload so newly added config files are picked up without having to
+// restart the watch. WatchConfigPaths runs until the returned channel
+// is closed.
+func WatchConfigPaths(paths []string, applier LiveConfigApplier, logger *log.Logger) (chan<- struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating config watcher: %s", err)
+	}
+
+	if err := addWatchPaths(watcher, paths); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	current, err := ReadConfigPaths(paths)
+	if err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("error reading initial config: %s", err)
+	}
+
+	stopCh := make(chan struct{})
+	go watchConfigLoop(watcher, paths, current, applier, logger, stopCh)
+
+	return stopCh, nil
+}
+
+// addWatchPaths (re-)adds every path to watcher. fsnotify silently
+// ignores an Add call for a path it's already watching, so this is
+// safe to call repeatedly. New files in a watched directory are
+// reported by that directory's own watch, not by re-adding it;
+// ReadConfigPaths then picks them up when it re-reads the directory.
+func addWatchPaths(watcher *fsnotify.Watcher, paths []string) error {
+	for _, path := range paths {
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("error watching '%s': %s", path, err)
+		}
+	}
+	return nil
+}
+
+func watchConfigLoop(watcher *fsnotify.Watcher, paths []string, current *Config, applier LiveConfigApplier, logger *log.Logger, stopCh <-chan struct{}) {
+	defer watcher.Close()
+
+	reload := make(chan struct{}, 1)
+	var debounce *time.Timer
+
+	triggerReload := func() {
+		if debounce == nil {
+			debounce = time.AfterFunc(configReloadDebounce, func() {
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			})
+			return
+		}
+		debounce.Reset(configReloadDebounce)
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// A new file may have appeared in a watched directory;
+			// re-adding is a cheap no-op for paths we already watch.
+			addWatchPaths(watcher, paths)
+			triggerReload()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Printf("[ERR] agent: config watcher error: %s", err)
+
+		case <-reload:
+			updated, err := ReadConfigPaths(paths)
+			if err != nil {
+				logger.Printf("[ERR] agent: error reloading config: %s", err)
+				continue
+			}
+
+			applyConfigReload(current, updated, applier, logger)
+			current = updated
+		}
+	}
+}
+
+// applyConfigReload diffs old against updated, applies the
+// hot-reloadable subset via applier, and logs both the successful
+// reload and any fields that were changed but need a restart.
+func applyConfigReload(old, updated *Config, applier LiveConfigApplier, logger *log.Logger) {
+	changed := configDiff(old, updated)
+	if len(changed) == 0 {
+		return
+	}
+
+	var restartRequired []string
+	for _, field := range changed {
+		if !hotReloadableFields[field] {
+			restartRequired = append(restartRequired, field)
+		}
+	}
+
+	if applier != nil {
+		if err := applier.SetTags(updated.Tags, updated.Role); err != nil {
+			logger.Printf("[ERR] agent: failed to reload tags: %s", err)
+		}
+
+		if scripts, err := updated.EventScripts(); err != nil {
+			logger.Printf("[ERR] agent: failed to parse event handlers: %s", err)
+		} else if err := applier.SetEventHandlers(scripts); err != nil {
+			logger.Printf("[ERR] agent: failed to reload event handlers: %s", err)
+		}
+
+		applier.SetLogLevel(updated.LogLevel)
+
+		if key, err := updated.EncryptBytes(); err != nil {
+			logger.Printf("[ERR] agent: failed to decode encrypt key: %s", err)
+		} else if len(key) > 0 {
+			if err := applier.SetEncryptKey(key); err != nil {
+				logger.Printf("[ERR] agent: failed to rotate encrypt key: %s", err)
+			}
+		}
+	}
+
+	logger.Printf("[INFO] agent: config reloaded, changed fields: %v", changed)
+	if len(restartRequired) > 0 {
+		logger.Printf("[WARN] agent: fields changed but require an agent restart: %v", restartRequired)
+	}
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConfigApplier records calls made by WatchConfigPaths so tests
+// can assert on what was reloaded without a real Agent.
+type fakeConfigApplier struct {
+	mu       sync.Mutex
+	tags     map[string]string
+	role     string
+	scripts  []EventScript
+	logLevel string
+}
+
+func (f *fakeConfigApplier) SetTags(tags map[string]string, role string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tags = tags
+	f.role = role
+	return nil
+}
+
+func (f *fakeConfigApplier) SetEventHandlers(scripts []EventScript) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = scripts
+	return nil
+}
+
+func (f *fakeConfigApplier) SetLogLevel(level string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logLevel = level
+}
+
+func (f *fakeConfigApplier) SetEncryptKey(key []byte) error {
+	return nil
+}
+
+func (f *fakeConfigApplier) Scripts() []EventScript {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scripts
+}
+
+func TestWatchConfigPaths_reloadsEventHandlers(t *testing.T) {
+	td, err := ioutil.TempDir("", "serf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	confPath := filepath.Join(td, "a.json")
+	if err := ioutil.WriteFile(confPath, []byte(`{"node_name": "bar"}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	applier := &fakeConfigApplier{}
+	var logBuf bytes.Buffer
+	logger := log.New(&logBuf, "", 0)
+
+	stopCh, err := WatchConfigPaths([]string{td}, applier, logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer close(stopCh)
+
+	if err := ioutil.WriteFile(confPath, []byte(`{"node_name": "bar", "event_handlers": ["foo.sh"]}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []EventScript{{NodeEvent: "*", Name: "", Script: "foo.sh"}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(applier.Scripts(), expected) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("event handlers were not reloaded, got: %#v", applier.Scripts())
+}